@@ -15,14 +15,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"time"
-)
 
-const (
-	golopVersion = "0.2.1"
+	"github.com/klausman/golop/pkg/emergelog"
 )
 
 var (
@@ -31,117 +29,54 @@ var (
 	modeHistory  = flag.Bool("e", true, "Show history")
 	modeVersion  = flag.Bool("v", false, "Show golop version information and exit")
 	logfilename  = flag.String("l", "/var/log/emerge.log", "Location of emerge log to parse.")
+	procDir      = flag.String("d", "/proc", "Root of /proc filesystem")
+	filterExpr   = flag.String("filter", "", "Filter history/estimate results, e.g. \"pkgname like gcc && duration > 30m\"")
+	aggregate    = flag.String("agg", "", "Aggregate history/estimate results instead of listing them: count, sum, mean, median or p90")
+	modeWatch    = flag.Bool("w", false, "Watch the log continuously, printing updates as compiles progress")
+	listenAddr   = flag.String("listen", "", "Serve Prometheus metrics on this address in watch mode, e.g. :9184")
+	modeUnmerge  = flag.Bool("u", false, "Show unmerge history")
+	outputFormat = flag.String("o", "text", "Output format: text, json, ndjson or csv")
 )
 
 func main() {
 	flag.Parse()
 
-	logfile, err := os.Open(*logfilename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not open log file '%s': %s\n", *logfilename, err)
-		os.Exit(1)
-	}
-
-	if *modeVersion {
-		fmt.Printf("golop version %s\n", golopVersion)
-		os.Exit(0)
+	cfg := emergelog.Config{
+		LogFile:    *logfilename,
+		ProcDir:    *procDir,
+		Pattern:    *modeEstimate,
+		FilterExpr: *filterExpr,
+		Aggregate:  *aggregate,
+		Listen:     *listenAddr,
+		Output:     *outputFormat,
 	}
 
-	if *modeCurrent {
-		mdus := findMedDurations(logfile)
-		curr, err := runningCompiles()
-		if err != nil {
-			panic(err)
-		}
-		if len(curr) == 0 {
-			fmt.Printf("No compilations currently running.\n")
-			os.Exit(0)
-		}
-
-		var sts []compileStatus
-		longest := 0
-		for _, c := range curr {
-			status := compileStatus{pkgname: c.pkg, phase: c.phase}
-			if len(c.pkg) > longest {
-				longest = len(c.pkg)
-			}
-			n, _ := splitpkgver(status.pkgname)
-			md, ok := mdus[n]
-			if ok {
-				eta := md - time.Since(c.start).Round(time.Second)
-				if eta < 0 {
-					status.eta = "any time now"
-				} else {
-					status.eta = eta.String()
-				}
-			}
-			status.elapsed = time.Since(c.start).Round(time.Second).String()
-			sts = append(sts, status)
-		}
-		fmt.Println(tabulate(sts, longest))
-		os.Exit(0)
+	switch {
+	case *modeVersion:
+		cfg.Mode = emergelog.ModeVersion
+	case *modeWatch:
+		cfg.Mode = emergelog.ModeWatch
+	case *modeCurrent:
+		cfg.Mode = emergelog.ModeCurrent
+	case *modeUnmerge:
+		cfg.Mode = emergelog.ModeUnmerge
+	case *modeEstimate != "":
+		cfg.Mode = emergelog.ModeEstimate
+	case *modeHistory:
+		cfg.Mode = emergelog.ModeHistory
+	default:
+		// The user deactivated modeHistory explicitly and did not
+		// activate another mode
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	if *modeEstimate != "" {
-		compiles, _, durations := findCompileHist(logfile, nil)
-		var filtered []compileHist
-		pattern := *modeEstimate
-
-		// We only want the first match of a possible substring, so we replace
-		// pattern with the full pkgname on first match and then only compare
-		// literally
-		firstmatched := false
-		for _, compile := range compiles {
-			if firstmatched && compile.pkgname == pattern {
-				filtered = append(filtered, compile)
-				continue
-			}
-			// We don't have a match yet, compare more generously
-			if !firstmatched && pkgnameMatch(compile.pkgname, pattern) {
-				filtered = append(filtered, compile)
-				pattern = compile.pkgname
-				firstmatched = true
-			}
-		}
-		if len(filtered) == 0 {
-			fmt.Printf("Found no compilations matching %s\n", *modeEstimate)
+	if err := emergelog.Run(cfg, os.Stdout); err != nil {
+		if errors.Is(err, emergelog.ErrNoMatch) {
+			fmt.Printf("Found no compilations matching %s\n", cfg.Pattern)
 			os.Exit(2)
 		}
-
-		hists := showHistory(filtered, time.Unix(0, 0))
-		// Since we have turned the pattern into the full pkgname, this will
-		// always succeed
-		durs := durations[pattern]
-		meddur := medDuration(durs)
-
-		fmt.Printf("%s\nMedian duration: %+v\n", hists, meddur.Round(time.Second))
-		os.Exit(0)
-	}
-
-	if *modeHistory {
-		compiles, _, _ := findCompileHist(logfile, nil)
-		fmt.Printf("%s\n", showHistory(compiles, time.Unix(0, 0)))
-		os.Exit(0)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-
-	// If we reach this spot, the user deactivated modeHistory explicitly and
-	// did not activate another mode
-	flag.Usage()
-	os.Exit(1)
-
-}
-
-type compileHist struct {
-	start      time.Time
-	end        time.Time
-	dur        time.Duration
-	pkgname    string
-	pkgversion string
-}
-
-type compileStatus struct {
-	pkgname string
-	elapsed string
-	eta     string
-	phase   string
 }
@@ -0,0 +1,108 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Aggregation selects how showHistory summarizes a set of compiles,
+// instead of listing them individually.
+type Aggregation int
+
+// The aggregations showHistory understands, mirroring the -agg flag.
+const (
+	AggNone Aggregation = iota
+	AggCount
+	AggSum
+	AggMean
+	AggMedian
+	AggP90
+)
+
+// ParseAggregation maps a -agg flag value to an Aggregation. An empty
+// name yields AggNone.
+func ParseAggregation(name string) (Aggregation, error) {
+	switch name {
+	case "":
+		return AggNone, nil
+	case "count":
+		return AggCount, nil
+	case "sum":
+		return AggSum, nil
+	case "mean":
+		return AggMean, nil
+	case "median":
+		return AggMedian, nil
+	case "p90":
+		return AggP90, nil
+	default:
+		return AggNone, fmt.Errorf("unknown aggregation %q", name)
+	}
+}
+
+func aggregateHistory(compiles []compileHist, agg Aggregation) string {
+	durs := make(sortableDurs, 0, len(compiles))
+	for _, c := range compiles {
+		durs = append(durs, c.dur)
+	}
+	return aggregateDurations(durs, len(compiles), agg)
+}
+
+// aggregateDurations summarizes durs (and the count of items it was
+// derived from) the way agg selects. It backs both aggregateHistory and
+// showUnmergeHistory, since both ultimately reduce a set of durations.
+func aggregateDurations(durs sortableDurs, count int, agg Aggregation) string {
+	switch agg {
+	case AggCount:
+		return fmt.Sprintf("Count: %d", count)
+	case AggSum:
+		return fmt.Sprintf("Sum duration: %+v", sumDuration(durs).Round(time.Second))
+	case AggMean:
+		return fmt.Sprintf("Mean duration: %+v", meanDuration(durs).Round(time.Second))
+	case AggMedian:
+		return fmt.Sprintf("Median duration: %+v", medDuration(durs).Round(time.Second))
+	case AggP90:
+		return fmt.Sprintf("p90 duration: %+v", p90Duration(durs).Round(time.Second))
+	default:
+		return ""
+	}
+}
+
+func sumDuration(durs sortableDurs) time.Duration {
+	var sum time.Duration
+	for _, d := range durs {
+		sum += d
+	}
+	return sum
+}
+
+func meanDuration(durs sortableDurs) time.Duration {
+	if len(durs) == 0 {
+		return 0
+	}
+	return sumDuration(durs) / time.Duration(len(durs))
+}
+
+func p90Duration(durs sortableDurs) time.Duration {
+	if len(durs) == 0 {
+		return 0
+	}
+	sort.Sort(durs)
+	idx := int(float64(len(durs)-1) * 0.9)
+	return durs[idx]
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"testing"
+	"time"
+)
+
+// fixtureDurs are four durations chosen so sum/mean/median/p90 each land
+// on a distinct, easily hand-checked value: sum=22m, mean=5m30s,
+// median=4m (medDuration's even-count path picks durs[(mpl+mph)/2], not
+// a true average of the middle pair), p90=6m (idx = int((4-1)*0.9) = 2
+// into the sorted [2,4,6,10]).
+var fixtureDurs = []time.Duration{
+	2 * time.Minute, 4 * time.Minute, 6 * time.Minute, 10 * time.Minute,
+}
+
+func fixtureCompiles() []compileHist {
+	compiles := make([]compileHist, len(fixtureDurs))
+	for i, d := range fixtureDurs {
+		compiles[i] = compileHist{pkgname: "dev-lang/go", pkgversion: "1.21.0", dur: d}
+	}
+	return compiles
+}
+
+func fixtureUnmerges() []unmergeHist {
+	unmerges := make([]unmergeHist, len(fixtureDurs))
+	for i, d := range fixtureDurs {
+		unmerges[i] = unmergeHist{pkgname: "dev-lang/go", pkgversion: "1.20.0", dur: d}
+	}
+	return unmerges
+}
+
+func TestParseAggregation(t *testing.T) {
+	cases := []struct {
+		name string
+		want Aggregation
+	}{
+		{"", AggNone},
+		{"count", AggCount},
+		{"sum", AggSum},
+		{"mean", AggMean},
+		{"median", AggMedian},
+		{"p90", AggP90},
+	}
+	for _, tc := range cases {
+		got, err := ParseAggregation(tc.name)
+		if err != nil {
+			t.Errorf("ParseAggregation(%q): %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("ParseAggregation(%q) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseAggregationUnknown(t *testing.T) {
+	if _, err := ParseAggregation("bogus"); err == nil {
+		t.Error("ParseAggregation(\"bogus\") returned no error, want one")
+	}
+}
+
+func TestAggregateHistory(t *testing.T) {
+	cases := []struct {
+		agg  Aggregation
+		want string
+	}{
+		{AggCount, "Count: 4"},
+		{AggSum, "Sum duration: 22m0s"},
+		{AggMean, "Mean duration: 5m30s"},
+		{AggMedian, "Median duration: 4m0s"},
+		{AggP90, "p90 duration: 6m0s"},
+	}
+	compiles := fixtureCompiles()
+	for _, tc := range cases {
+		if got := aggregateHistory(compiles, tc.agg); got != tc.want {
+			t.Errorf("aggregateHistory(_, %v) = %q, want %q", tc.agg, got, tc.want)
+		}
+	}
+}
+
+func TestAggregateHistoryNone(t *testing.T) {
+	if got := aggregateHistory(fixtureCompiles(), AggNone); got != "" {
+		t.Errorf("aggregateHistory(_, AggNone) = %q, want empty", got)
+	}
+}
+
+func TestShowHistoryAggregates(t *testing.T) {
+	got := showHistory(fixtureCompiles(), time.Unix(0, 0), AggSum)
+	want := "Sum duration: 22m0s"
+	if got != want {
+		t.Errorf("showHistory(_, _, AggSum) = %q, want %q", got, want)
+	}
+}
+
+func TestShowUnmergeHistoryAggregates(t *testing.T) {
+	got := showUnmergeHistory(fixtureUnmerges(), AggMean)
+	want := "Mean duration: 5m30s"
+	if got != want {
+		t.Errorf("showUnmergeHistory(_, AggMean) = %q, want %q", got, want)
+	}
+}
+
+func TestSumDuration(t *testing.T) {
+	if got := sumDuration(fixtureDurs); got != 22*time.Minute {
+		t.Errorf("sumDuration = %v, want 22m0s", got)
+	}
+}
+
+func TestMeanDuration(t *testing.T) {
+	if got := meanDuration(fixtureDurs); got != 5*time.Minute+30*time.Second {
+		t.Errorf("meanDuration = %v, want 5m30s", got)
+	}
+}
+
+func TestMeanDurationEmpty(t *testing.T) {
+	if got := meanDuration(nil); got != 0 {
+		t.Errorf("meanDuration(nil) = %v, want 0", got)
+	}
+}
+
+func TestP90Duration(t *testing.T) {
+	if got := p90Duration(fixtureDurs); got != 6*time.Minute {
+		t.Errorf("p90Duration = %v, want 6m0s", got)
+	}
+}
+
+func TestP90DurationEmpty(t *testing.T) {
+	if got := p90Duration(nil); got != 0 {
+		t.Errorf("p90Duration(nil) = %v, want 0", got)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Filter decides whether a single compileHist entry should be kept.
+//
+// Filters are built by ParseFilter from expressions such as:
+//
+//	pkgname like gcc && duration > 30m && start >= 2024-01-01
+//
+// The known fields are pkgname, pkgversion, duration, start and end;
+// the comparators are =, !=, <, <=, >, >= and like; and terms can be
+// combined with &&, || and ! with the usual precedence (! binds
+// tightest, then &&, then ||). Parentheses may be used to override
+// precedence. phase is rejected: a completed compile has already passed
+// through every phase, so there is no single phase left to compare.
+type Filter interface {
+	Match(c compileHist) bool
+}
+
+type filterFunc func(c compileHist) bool
+
+func (f filterFunc) Match(c compileHist) bool { return f(c) }
+
+// ParseFilter parses expr into a Filter. An empty (or all-whitespace)
+// expr yields a nil Filter that matches everything.
+func ParseFilter(expr string) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in filter expression", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+// filterCompiles returns the subset of compiles matched by f. A nil f
+// matches everything.
+func filterCompiles(compiles []compileHist, f Filter) []compileHist {
+	if f == nil {
+		return compiles
+	}
+	var out []compileHist
+	for _, c := range compiles {
+		if f.Match(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func tokenizeFilter(expr string) ([]string, error) {
+	var tokens []string
+	i, n := 0, len(expr)
+	for i < n {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(expr[i:], "&&"):
+			tokens = append(tokens, "&&")
+			i += 2
+		case strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, "||")
+			i += 2
+		case strings.HasPrefix(expr[i:], ">="), strings.HasPrefix(expr[i:], "<="), strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < n && expr[j] != c {
+				j++
+			}
+			if j >= n {
+				return nil, fmt.Errorf("unterminated quoted string in filter expression")
+			}
+			tokens = append(tokens, expr[i+1:j])
+			i = j + 1
+		default:
+			j := i
+			for j < n && !isFilterTokenBoundary(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isFilterTokenBoundary(c byte) bool {
+	switch c {
+	case ' ', '\t', '(', ')', '=', '<', '>', '!', '&', '|':
+		return true
+	}
+	return false
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = filterFunc(func(c compileHist) bool { return l.Match(c) || r.Match(c) })
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = filterFunc(func(c compileHist) bool { return l.Match(c) && r.Match(c) })
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.peek() == "!" {
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterFunc(func(c compileHist) bool { return !f.Match(c) }), nil
+	}
+	if p.peek() == "(" {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing ')' in filter expression")
+		}
+		p.next()
+		return f, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Filter, error) {
+	field := p.next()
+	if field == "" {
+		return nil, fmt.Errorf("expected field name in filter expression")
+	}
+	op := p.next()
+	if op == "" {
+		return nil, fmt.Errorf("expected comparator after field %q", field)
+	}
+	value := p.next()
+	if value == "" {
+		return nil, fmt.Errorf("expected value after %s %s", field, op)
+	}
+	return buildCompareFilter(field, op, value)
+}
+
+func buildCompareFilter(field, op, value string) (Filter, error) {
+	switch field {
+	case "pkgname":
+		return stringCompareFilter(func(c compileHist) string { return c.pkgname }, op, value)
+	case "pkgversion":
+		return stringCompareFilter(func(c compileHist) string { return c.pkgversion }, op, value)
+	case "phase":
+		// Phase transitions are only meaningful for the in-progress
+		// compile a phase-hook line belongs to; a completed compileHist
+		// has already passed through all of them, so there is no single
+		// phase to compare against. Reject the field explicitly rather
+		// than silently matching nothing.
+		return nil, fmt.Errorf("filter field %q is not supported for history/estimate filters", field)
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		return durationCompareFilter(func(c compileHist) time.Duration { return c.dur }, op, d)
+	case "start":
+		t, err := parseFilterTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return timeCompareFilter(func(c compileHist) time.Time { return c.start }, op, t)
+	case "end":
+		t, err := parseFilterTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return timeCompareFilter(func(c compileHist) time.Time { return c.end }, op, t)
+	default:
+		return nil, fmt.Errorf("unknown filter field %q", field)
+	}
+}
+
+func stringCompareFilter(get func(compileHist) string, op, value string) (Filter, error) {
+	switch op {
+	case "=":
+		return filterFunc(func(c compileHist) bool { return get(c) == value }), nil
+	case "!=":
+		return filterFunc(func(c compileHist) bool { return get(c) != value }), nil
+	case "like":
+		low := strings.ToLower(value)
+		return filterFunc(func(c compileHist) bool { return strings.Contains(strings.ToLower(get(c)), low) }), nil
+	default:
+		return nil, fmt.Errorf("operator %q not valid for string fields", op)
+	}
+}
+
+func durationCompareFilter(get func(compileHist) time.Duration, op string, value time.Duration) (Filter, error) {
+	switch op {
+	case "=":
+		return filterFunc(func(c compileHist) bool { return get(c) == value }), nil
+	case "!=":
+		return filterFunc(func(c compileHist) bool { return get(c) != value }), nil
+	case "<":
+		return filterFunc(func(c compileHist) bool { return get(c) < value }), nil
+	case "<=":
+		return filterFunc(func(c compileHist) bool { return get(c) <= value }), nil
+	case ">":
+		return filterFunc(func(c compileHist) bool { return get(c) > value }), nil
+	case ">=":
+		return filterFunc(func(c compileHist) bool { return get(c) >= value }), nil
+	default:
+		return nil, fmt.Errorf("operator %q not valid for duration fields", op)
+	}
+}
+
+func timeCompareFilter(get func(compileHist) time.Time, op string, value time.Time) (Filter, error) {
+	switch op {
+	case "=":
+		return filterFunc(func(c compileHist) bool { return get(c).Equal(value) }), nil
+	case "!=":
+		return filterFunc(func(c compileHist) bool { return !get(c).Equal(value) }), nil
+	case "<":
+		return filterFunc(func(c compileHist) bool { return get(c).Before(value) }), nil
+	case "<=":
+		return filterFunc(func(c compileHist) bool { return !get(c).After(value) }), nil
+	case ">":
+		return filterFunc(func(c compileHist) bool { return get(c).After(value) }), nil
+	case ">=":
+		return filterFunc(func(c compileHist) bool { return !get(c).Before(value) }), nil
+	default:
+		return nil, fmt.Errorf("operator %q not valid for time fields", op)
+	}
+}
+
+var filterTimeLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	for _, layout := range filterTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, want YYYY-MM-DD or RFC3339", value)
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFilterEmpty(t *testing.T) {
+	f, err := ParseFilter("   ")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	if f != nil {
+		t.Fatalf("expected nil Filter for an empty expression, got %v", f)
+	}
+}
+
+func TestParseFilterMatch(t *testing.T) {
+	c := compileHist{
+		pkgname:    "dev-lang/go",
+		pkgversion: "1.21.0",
+		start:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		end:        time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC),
+		dur:        30 * time.Minute,
+	}
+	cases := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"pkgname like", "pkgname like go", true},
+		{"pkgname like no match", "pkgname like rust", false},
+		{"pkgname eq", "pkgname = dev-lang/go", true},
+		{"pkgversion neq", `pkgversion != 1.21.0`, false},
+		{"duration gt", "duration > 10m", true},
+		{"duration lt", "duration < 10m", false},
+		{"start ge", "start >= 2024-01-01", true},
+		{"and", "pkgname like go && duration > 10m", true},
+		{"or", "pkgname like rust || duration > 10m", true},
+		{"not", "!(pkgname like rust)", true},
+		{"parens", "(pkgname like go && duration > 10m) || pkgname like rust", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseFilter(tc.expr)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q): %v", tc.expr, err)
+			}
+			if got := f.Match(c); got != tc.want {
+				t.Errorf("ParseFilter(%q).Match(c) = %v, want %v", tc.expr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"pkgname like",
+		"pkgname",
+		"pkgname like go &&",
+		"(pkgname like go",
+		"duration > nope",
+		"start >= nope",
+		"phase = compile",
+		"nosuchfield = go",
+	}
+	for _, expr := range cases {
+		if expr == "" {
+			continue
+		}
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseFilter(expr); err == nil {
+				t.Errorf("ParseFilter(%q): expected an error, got nil", expr)
+			}
+		})
+	}
+}
+
+func TestFilterCompiles(t *testing.T) {
+	compiles := []compileHist{
+		{pkgname: "dev-lang/go", dur: 10 * time.Minute},
+		{pkgname: "sys-devel/gcc", dur: 40 * time.Minute},
+	}
+	f, err := ParseFilter("duration > 20m")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	got := filterCompiles(compiles, f)
+	if len(got) != 1 || got[0].pkgname != "sys-devel/gcc" {
+		t.Fatalf("filterCompiles = %+v, want only sys-devel/gcc", got)
+	}
+	if got := filterCompiles(compiles, nil); len(got) != len(compiles) {
+		t.Fatalf("filterCompiles with nil Filter = %+v, want all %d compiles", got, len(compiles))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func showHistory(compiles []compileHist, start time.Time, agg Aggregation) string {
+	if agg != AggNone {
+		return aggregateHistory(compiles, agg)
+	}
+	var ret []string
+	var shown int
+	for _, compile := range compiles {
+		if compile.start.UnixNano() >= start.UnixNano() {
+			shown++
+			ret = append(ret,
+				fmt.Sprintf("%s: %s-%s: %+v",
+					compile.start.Format(time.RFC3339), compile.pkgname, compile.pkgversion,
+					compile.dur.Round(time.Second)))
+		}
+	}
+	ret = append(ret,
+		fmt.Sprintf("Total number of compilations: %d", shown))
+	return strings.Join(ret, "\n")
+}
+
+func showUnmergeHistory(unmerges []unmergeHist, agg Aggregation) string {
+	if agg != AggNone {
+		durs := make(sortableDurs, 0, len(unmerges))
+		for _, u := range unmerges {
+			durs = append(durs, u.dur)
+		}
+		return aggregateDurations(durs, len(unmerges), agg)
+	}
+	var ret []string
+	for _, u := range unmerges {
+		ret = append(ret,
+			fmt.Sprintf("%s: %s-%s: %+v",
+				u.start.Format(time.RFC3339), u.pkgname, u.pkgversion, u.dur.Round(time.Second)))
+	}
+	ret = append(ret, fmt.Sprintf("Total number of unmerges: %d", len(unmerges)))
+	return strings.Join(ret, "\n")
+}
+
+func medDuration(durs sortableDurs) time.Duration {
+	sort.Sort(durs)
+	if len(durs)%2 != 0 {
+		// And odd number of elements there is a definite middle element
+		return durs[len(durs)/2]
+	}
+	// An even number of elements means we need to average the midmodst pair
+	mph := len(durs) / 2
+	mpl := mph - 1
+	return durs[(mpl+mph)/2]
+}
+
+type sortableDurs []time.Duration
+
+func (d sortableDurs) Len() int           { return len(d) }
+func (d sortableDurs) Less(i, j int) bool { return d[i] < d[j] }
+func (d sortableDurs) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func pkgnameMatch(pkgname, pattern string) bool {
+	if pkgname == pattern {
+		return true
+	}
+	components := strings.Split(pkgname, "/")
+	if len(components) != 2 {
+		// This should never happen, but let's be defensive
+		return false
+	}
+	if components[1] == pattern {
+		return true
+	}
+	return false
+}
+
+func tabulate(p []compileStatus, longest int) string {
+	var out []string
+	tmpl := fmt.Sprintf("%%%ds %%10s %%10s %%-22s %%8s %%8s %%8s %%6s", longest)
+	out = append(out, fmt.Sprintf(tmpl, "Package", "Phase", "Elapsed", "ETA", "P50", "P90", "±", "Phase%"))
+	for _, c := range p {
+		out = append(out, fmt.Sprintf(tmpl, c.pkgname, c.phase, c.elapsed, c.eta,
+			c.p50.Round(time.Second), c.p90.Round(time.Second), c.confidence.Round(time.Second),
+			fmt.Sprintf("%.0f%%", c.phaseFrac*100)))
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// histBuckets are the golop_compile_duration_seconds histogram
+// boundaries, chosen to span typical ebuild compile times from quick
+// binpkg-sized installs to multi-hour builds (chromium, rust, ...).
+var histBuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+// Exporter serves a Prometheus /metrics page describing a Watcher's
+// current in-memory model.
+type Exporter struct {
+	watcher *Watcher
+}
+
+// NewExporter returns an Exporter backed by w.
+func NewExporter(w *Watcher) *Exporter {
+	return &Exporter{watcher: w}
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, e.watcher)
+}
+
+func writeMetrics(w io.Writer, wt *Watcher) {
+	writeDurationHistogram(w, wt.Completed())
+	writeInProgress(w, wt)
+	writeUnmergeTotal(w, wt.UnmergeTotal())
+}
+
+func splitCategory(pkgname string) (category, name string) {
+	parts := strings.SplitN(pkgname, "/", 2)
+	if len(parts) != 2 {
+		return "", pkgname
+	}
+	return parts[0], parts[1]
+}
+
+func writeDurationHistogram(w io.Writer, compiles []compileHist) {
+	byPkg := make(map[string][]time.Duration)
+	for _, c := range compiles {
+		byPkg[c.pkgname] = append(byPkg[c.pkgname], c.dur)
+	}
+
+	fmt.Fprintln(w, "# HELP golop_compile_duration_seconds Duration of completed emerge compiles.")
+	fmt.Fprintln(w, "# TYPE golop_compile_duration_seconds histogram")
+	for _, pkgname := range sortedKeys(byPkg) {
+		category, name := splitCategory(pkgname)
+		durs := byPkg[pkgname]
+		var sum float64
+		counts := make([]int, len(histBuckets))
+		for _, d := range durs {
+			sum += d.Seconds()
+			for i, b := range histBuckets {
+				if d.Seconds() <= b {
+					counts[i]++
+				}
+			}
+		}
+		for i, b := range histBuckets {
+			fmt.Fprintf(w, "golop_compile_duration_seconds_bucket{category=%q,name=%q,le=%q} %d\n",
+				category, name, formatBucket(b), counts[i])
+		}
+		fmt.Fprintf(w, "golop_compile_duration_seconds_bucket{category=%q,name=%q,le=\"+Inf\"} %d\n",
+			category, name, len(durs))
+		fmt.Fprintf(w, "golop_compile_duration_seconds_sum{category=%q,name=%q} %f\n", category, name, sum)
+		fmt.Fprintf(w, "golop_compile_duration_seconds_count{category=%q,name=%q} %d\n", category, name, len(durs))
+	}
+}
+
+func formatBucket(b float64) string {
+	return fmt.Sprintf("%g", b)
+}
+
+// inprogressLabels is the Prometheus label set writeInProgress emits
+// golop_compile_inprogress and golop_compile_eta_seconds under. Two
+// concurrent --jobs builds of the same package-version (see instanceKey)
+// share a label set, so samples must be aggregated per label set rather
+// than emitted once per instance: repeating a label set within one
+// metric is invalid exposition format and Prometheus rejects the whole
+// scrape over it.
+type inprogressLabels struct {
+	category, name, phase string
+}
+
+func writeInProgress(w io.Writer, wt *Watcher) {
+	fmt.Fprintln(w, "# HELP golop_compile_inprogress Emerges currently in progress.")
+	fmt.Fprintln(w, "# TYPE golop_compile_inprogress gauge")
+	fmt.Fprintln(w, "# HELP golop_compile_eta_seconds Estimated time remaining for in-progress emerges.")
+	fmt.Fprintln(w, "# TYPE golop_compile_eta_seconds gauge")
+	inprogress := wt.InProgress()
+	durations := wt.Durations()
+
+	counts := make(map[inprogressLabels]int)
+	etas := make(map[inprogressLabels]time.Duration)
+	haveETA := make(map[inprogressLabels]bool)
+	for _, key := range sortedKeysHist(inprogress) {
+		c := inprogress[key]
+		category, name := splitCategory(c.pkgname)
+		phase, _ := wt.CurrentPhase(basePkgver(key))
+		labels := inprogressLabels{category, name, phase}
+		counts[labels]++
+
+		durs := durations[c.pkgname]
+		if len(durs) == 0 {
+			continue
+		}
+		p50 := weightedPercentile(durs, 0.5)
+		frac := remainingFraction(phase, wt.PhaseFractions(c.pkgname))
+		eta := remainingEstimate(p50, frac, time.Since(c.start))
+		if eta < 0 {
+			eta = 0
+		}
+		if !haveETA[labels] || eta < etas[labels] {
+			etas[labels] = eta
+			haveETA[labels] = true
+		}
+	}
+
+	for _, labels := range sortedInprogressLabels(counts) {
+		fmt.Fprintf(w, "golop_compile_inprogress{category=%q,name=%q,phase=%q} %d\n",
+			labels.category, labels.name, labels.phase, counts[labels])
+		if haveETA[labels] {
+			fmt.Fprintf(w, "golop_compile_eta_seconds{category=%q,name=%q,phase=%q} %f\n",
+				labels.category, labels.name, labels.phase, etas[labels].Seconds())
+		}
+	}
+}
+
+func sortedInprogressLabels(m map[inprogressLabels]int) []inprogressLabels {
+	keys := make([]inprogressLabels, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.category != b.category {
+			return a.category < b.category
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.phase < b.phase
+	})
+	return keys
+}
+
+func writeUnmergeTotal(w io.Writer, total int) {
+	fmt.Fprintln(w, "# HELP golop_unmerges_total Number of completed unmerges seen.")
+	fmt.Fprintln(w, "# TYPE golop_unmerges_total counter")
+	fmt.Fprintf(w, "golop_unmerges_total %d\n", total)
+}
+
+func sortedKeys(m map[string][]time.Duration) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeysHist(m map[string]compileHist) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
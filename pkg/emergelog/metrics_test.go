@@ -0,0 +1,44 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteInProgressDedupesConcurrentSamePackage(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: >>> emerge (1 of 2) dev-lang/go-1.21.0 to /`,
+		`1700000100: >>> emerge (2 of 2) dev-lang/go-1.21.0 to /`,
+	)
+	w, err := NewWatcher(f.Name())
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writeInProgress(&buf, w)
+	out := buf.String()
+
+	const label = `{category="dev-lang",name="go",phase=""}`
+	if n := strings.Count(out, "golop_compile_inprogress"+label); n != 1 {
+		t.Fatalf("golop_compile_inprogress%s appeared %d times, want 1:\n%s", label, n, out)
+	}
+	if !strings.Contains(out, "golop_compile_inprogress"+label+" 2\n") {
+		t.Errorf("golop_compile_inprogress%s should report a count of 2 instances, got:\n%s", label, out)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// OutputFormat selects how ModeHistory, ModeEstimate, ModeCurrent and
+// ModeUnmerge render their results.
+type OutputFormat int
+
+// The output formats golop understands, mirroring the -o flag. FormatText
+// is the default and is rendered by the existing ad-hoc
+// showHistory/tabulate string formatting rather than through an Encoder.
+const (
+	FormatText OutputFormat = iota
+	FormatJSON
+	FormatNDJSON
+	FormatCSV
+)
+
+// ParseOutputFormat maps a -o flag value to an OutputFormat. An empty
+// name yields FormatText.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch name {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	case "ndjson":
+		return FormatNDJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	default:
+		return FormatText, fmt.Errorf("unknown output format %q", name)
+	}
+}
+
+// Record is the machine-readable shape golop encodes a compile or unmerge
+// into for every non-text OutputFormat. Fields that don't apply to a
+// given record (e.g. p50_seconds for a completed compile) are left at
+// their zero value and omitted from JSON/NDJSON output.
+type Record struct {
+	Start           *time.Time `json:"start,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+	DurationSeconds *float64   `json:"duration_seconds,omitempty"`
+	Package         string     `json:"package,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	Version         string     `json:"version,omitempty"`
+	Phase           string     `json:"phase,omitempty"`
+	ETASeconds      *float64   `json:"eta_seconds,omitempty"`
+	P50Seconds      *float64   `json:"p50_seconds,omitempty"`
+	P90Seconds      *float64   `json:"p90_seconds,omitempty"`
+}
+
+// recordFields lists Record's fields in the stable order the CSV encoder
+// writes them.
+var recordFields = []string{
+	"start", "end", "duration_seconds", "package", "category", "version",
+	"phase", "eta_seconds", "p50_seconds", "p90_seconds",
+}
+
+func secondsPtr(d time.Duration) *float64 {
+	s := d.Seconds()
+	return &s
+}
+
+func recordsFromCompiles(compiles []compileHist) []Record {
+	records := make([]Record, 0, len(compiles))
+	for _, c := range compiles {
+		category, name := splitCategory(c.pkgname)
+		start, end := c.start, c.end
+		records = append(records, Record{
+			Start:           &start,
+			End:             &end,
+			DurationSeconds: secondsPtr(c.dur),
+			Package:         name,
+			Category:        category,
+			Version:         c.pkgversion,
+		})
+	}
+	return records
+}
+
+func recordsFromUnmerges(unmerges []unmergeHist) []Record {
+	records := make([]Record, 0, len(unmerges))
+	for _, u := range unmerges {
+		category, name := splitCategory(u.pkgname)
+		start, end := u.start, u.end
+		records = append(records, Record{
+			Start:           &start,
+			End:             &end,
+			DurationSeconds: secondsPtr(u.dur),
+			Package:         name,
+			Category:        category,
+			Version:         u.pkgversion,
+		})
+	}
+	return records
+}
+
+func recordsFromStatuses(sts []compileStatus) []Record {
+	records := make([]Record, 0, len(sts))
+	for _, s := range sts {
+		category, name := splitCategory(s.pkgname)
+		r := Record{
+			Package:  name,
+			Category: category,
+			Version:  s.pkgversion,
+			Phase:    s.phase,
+		}
+		if s.p50 != 0 {
+			r.P50Seconds = secondsPtr(s.p50)
+		}
+		if s.p90 != 0 {
+			r.P90Seconds = secondsPtr(s.p90)
+		}
+		if s.remaining != 0 {
+			r.ETASeconds = secondsPtr(s.remaining)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// Encoder renders a set of Records to out in a specific machine-readable
+// format.
+type Encoder interface {
+	Encode(out io.Writer, records []Record) error
+}
+
+// NewEncoder returns the Encoder for format. It panics on FormatText,
+// which is rendered by the legacy string formatting instead.
+func NewEncoder(format OutputFormat) Encoder {
+	switch format {
+	case FormatJSON:
+		return jsonEncoder{}
+	case FormatNDJSON:
+		return ndjsonEncoder{}
+	case FormatCSV:
+		return csvEncoder{}
+	default:
+		panic(fmt.Sprintf("no Encoder for output format %d", format))
+	}
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(out io.Writer, records []Record) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Encode(out io.Writer, records []Record) error {
+	enc := json.NewEncoder(out)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type csvEncoder struct{}
+
+func (csvEncoder) Encode(out io.Writer, records []Record) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(recordFields); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{
+			formatTimePtr(r.Start),
+			formatTimePtr(r.End),
+			formatFloatPtr(r.DurationSeconds),
+			r.Package,
+			r.Category,
+			r.Version,
+			r.Phase,
+			formatFloatPtr(r.ETASeconds),
+			formatFloatPtr(r.P50Seconds),
+			formatFloatPtr(r.P90Seconds),
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatFloatPtr(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
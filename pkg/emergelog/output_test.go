@@ -0,0 +1,91 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// goldenRecords exercises both Record constructors (a completed compile
+// and a running-compile status) so the golden files pin the schema
+// downstream consumers of -o json/ndjson/csv actually see.
+func goldenRecords() []Record {
+	compiles := []compileHist{
+		{
+			start:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:        time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC),
+			dur:        10 * time.Minute,
+			pkgname:    "dev-lang/go",
+			pkgversion: "1.21.0",
+		},
+	}
+	statuses := []compileStatus{
+		{
+			pkgname:    "sys-devel/gcc",
+			pkgversion: "13.2.0",
+			phase:      "compile",
+			p50:        20 * time.Minute,
+			p90:        30 * time.Minute,
+			remaining:  5 * time.Minute,
+		},
+	}
+	records := recordsFromCompiles(compiles)
+	records = append(records, recordsFromStatuses(statuses)...)
+	return records
+}
+
+// TestEncodersGoldenSchema pins the on-disk shape of -o json/ndjson/csv
+// against testdata/records.*. A diff here means the Record schema
+// changed in a way that will break downstream consumers silently unless
+// this test is updated (and its consequences considered) deliberately.
+func TestEncodersGoldenSchema(t *testing.T) {
+	records := goldenRecords()
+	cases := []struct {
+		name   string
+		format OutputFormat
+		golden string
+	}{
+		{"json", FormatJSON, "testdata/records.json"},
+		{"ndjson", FormatNDJSON, "testdata/records.ndjson"},
+		{"csv", FormatCSV, "testdata/records.csv"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewEncoder(tc.format).Encode(&buf, records); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			want, err := os.ReadFile(tc.golden)
+			if err != nil {
+				t.Fatalf("reading golden file: %v", err)
+			}
+			if buf.String() != string(want) {
+				t.Errorf("%s output does not match %s\ngot:\n%s\nwant:\n%s", tc.name, tc.golden, buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestNewEncoderPanicsOnText(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewEncoder(FormatText) to panic")
+		}
+	}()
+	NewEncoder(FormatText)
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package emergelog parses Portage's /var/log/emerge.log and reports on
+// past and currently running compiles.
+package emergelog
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"time"
+)
+
+var (
+	compileStartRegEx    *regexp.Regexp
+	binaryStartRegEx     *regexp.Regexp
+	installStartRegEx    *regexp.Regexp
+	compileCompleteRegEx *regexp.Regexp
+	unmergeStartRegEx    *regexp.Regexp
+	unmergeCompleteRegEx *regexp.Regexp
+	splitpkgverRegEx     *regexp.Regexp
+)
+
+func init() {
+	commonRegEx := `\((?P<ith>\d+) of (?P<total>\d+)\) (?P<package>[A-Za-z0-9/_-]+)-(?P<version>\d[^ ]+) to /`
+	compileStartRegEx = regexp.MustCompile(`>>> emerge ` + commonRegEx)
+	binaryStartRegEx = regexp.MustCompile(`>>> Emerging \(binary\) ` + commonRegEx)
+	installStartRegEx = regexp.MustCompile(`>>> Installing ` + commonRegEx)
+	compileCompleteRegEx = regexp.MustCompile(`::: completed emerge ` + commonRegEx)
+	unmergeStartRegEx = regexp.MustCompile(`=== Unmerging... \((?P<package>[A-Za-z0-9\/_-]+)-(?P<version>\d.*)\)`)
+	unmergeCompleteRegEx = regexp.MustCompile(`>>> unmerge success: (?P<package>[A-Za-z0-9/_-]+)-(?P<version>\d[^ ]+)`)
+	splitpkgverRegEx = regexp.MustCompile(`(?P<package>[A-Za-z0-9/_-]+)-(?P<version>\d[^ ]+)`)
+}
+
+// Parser holds the state accumulated while scanning an emerge.log, most
+// notably the start timestamps of compiles still open when the scan
+// ended. A Parser is not safe for concurrent use.
+type Parser struct {
+	// openStarts holds, per package, the start timestamps (oldest first)
+	// of compiles that were still in progress at the end of the last
+	// scan. RunningCompiles consumes these to tell apart two concurrent
+	// --jobs=N builds of the same package.
+	openStarts     map[string][]int64
+	phaseDurations map[string]map[string][]time.Duration
+}
+
+// NewParser returns a ready to use Parser.
+func NewParser() *Parser {
+	return &Parser{
+		openStarts:     make(map[string][]int64),
+		phaseDurations: make(map[string]map[string][]time.Duration),
+	}
+}
+
+type compileHist struct {
+	start      time.Time
+	end        time.Time
+	dur        time.Duration
+	pkgname    string
+	pkgversion string
+	// binary is true for packages installed from a binpkg rather than
+	// built from source, so their (typically much shorter) durations
+	// don't poison ETAs computed from source-build history.
+	binary bool
+}
+
+// unmergeHist records a single "=== Unmerging..." / ">>> unmerge
+// success:" pair.
+type unmergeHist struct {
+	start      time.Time
+	end        time.Time
+	dur        time.Duration
+	pkgname    string
+	pkgversion string
+}
+
+type compileStatus struct {
+	pkgname    string
+	pkgversion string
+	elapsed    string
+	eta        string
+	phase      string
+	p50        time.Duration
+	p90        time.Duration
+	phaseFrac  float64
+	confidence time.Duration
+	// remaining is the raw ETA duration eta was formatted from, kept
+	// around so structured OutputFormats can report eta_seconds without
+	// reparsing the human-readable string.
+	remaining time.Duration
+}
+
+func getReMatches(re *regexp.Regexp, tomatch string) map[string]string {
+	m := re.FindStringSubmatch(tomatch)
+	ret := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if i != 0 {
+			ret[name] = m[i]
+		}
+	}
+	return ret
+}
+
+// FindDurations scans fd for completed, source-built compiles and
+// returns, for each package, every duration seen, oldest first. Binpkg
+// installs are excluded so their much shorter durations don't skew the
+// estimates callers derive from the result. As a side effect it records
+// the start times of the compiles still open when the scan ended, which
+// RunningCompiles later uses to find the start time of in-progress
+// builds.
+func (p *Parser) FindDurations(fd *os.File) map[string][]time.Duration {
+	st := newScanState()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		p.scanLine(st, scanner.Text())
+	}
+	p.recordOpenStarts(st)
+	durations := make(map[string][]time.Duration)
+	for _, c := range st.compiles {
+		if c.binary {
+			continue
+		}
+		durations[c.pkgname] = append(durations[c.pkgname], c.dur)
+	}
+	return durations
+}
+
+// FindCompileHist scans fd for completed compiles and unmerges. It
+// returns the completed compiles in log order, the subset of in-progress
+// compiles whose package-version (ignoring the instance's start
+// timestamp) is present in running (or all of them if running is nil),
+// a map of the per-package durations seen for source builds (binpkg
+// installs are excluded, see compileHist.binary), and the completed
+// unmerges in log order.
+//
+// In-progress compiles are keyed by "pkgname-pkgversion@starttimestamp"
+// rather than just "pkgname-pkgversion", so that two concurrent emerges
+// of the same package-version (possible under --jobs=N, e.g. a rebuild
+// triggered twice) don't collide and overwrite one another.
+func (p *Parser) FindCompileHist(fd *os.File, running map[string]bool) ([]compileHist, map[string]compileHist, map[string][]time.Duration, []unmergeHist) {
+	st := newScanState()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		p.scanLine(st, scanner.Text())
+	}
+	p.recordOpenStarts(st)
+	nip := make(map[string]compileHist)
+	for key, v := range st.inprogress {
+		if running[basePkgver(key)] {
+			nip[key] = v
+		}
+	}
+	return st.compiles, nip, st.durations, st.unmergeCompleted
+}
+
+func splitpkgver(pv string) (string, string) {
+	values := getReMatches(splitpkgverRegEx, pv)
+	return values["package"], values["version"]
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLog creates a temporary emerge.log containing lines and returns an
+// open *os.File positioned at its start, closed automatically on test
+// cleanup.
+func writeLog(t *testing.T, lines ...string) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "emerge.log")
+	if err != nil {
+		t.Fatalf("CreateTemp: %v", err)
+	}
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		t.Fatalf("WriteString: %v", err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestFindCompileHistConcurrentSamePackage(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: >>> emerge (1 of 2) dev-lang/go-1.21.0 to /`,
+		`1700000100: >>> emerge (2 of 2) dev-lang/go-1.21.0 to /`,
+		`1700000600: ::: completed emerge (1 of 2) dev-lang/go-1.21.0 to /`,
+		`1700000700: ::: completed emerge (2 of 2) dev-lang/go-1.21.0 to /`,
+	)
+	p := NewParser()
+	compiles, _, _, _ := p.FindCompileHist(f, nil)
+	if len(compiles) != 2 {
+		t.Fatalf("FindCompileHist returned %d compiles, want 2", len(compiles))
+	}
+	if compiles[0].start.Unix() != 1700000000 || compiles[1].start.Unix() != 1700000100 {
+		t.Errorf("compiles started at %v/%v, want 1700000000/1700000100",
+			compiles[0].start.Unix(), compiles[1].start.Unix())
+	}
+	if compiles[0].dur != 10*time.Minute || compiles[1].dur != 10*time.Minute {
+		t.Errorf("compiles durations = %v/%v, want 10m/10m", compiles[0].dur, compiles[1].dur)
+	}
+}
+
+func TestScanLineRecognizesBinpkgFormats(t *testing.T) {
+	cases := []struct {
+		name       string
+		startLine  string
+		finishLine string
+	}{
+		{
+			name:       "Emerging binary",
+			startLine:  `1700000000: >>> Emerging (binary) (1 of 1) dev-lang/go-1.21.0 to /`,
+			finishLine: `1700000002: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+		},
+		{
+			name:       "Installing",
+			startLine:  `1700000000: >>> Installing (1 of 1) dev-lang/go-1.21.0 to /`,
+			finishLine: `1700000002: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := writeLog(t, tc.startLine, tc.finishLine)
+			p := NewParser()
+			compiles, _, durations, _ := p.FindCompileHist(f, nil)
+			if len(compiles) != 1 {
+				t.Fatalf("FindCompileHist returned %d compiles, want 1", len(compiles))
+			}
+			if !compiles[0].binary {
+				t.Errorf("compile.binary = false, want true for a binpkg install")
+			}
+			if _, ok := durations["dev-lang/go"]; ok {
+				t.Errorf("durations contains a binpkg install, want it excluded")
+			}
+		})
+	}
+}
+
+// TestScanLineCoalescesBinpkgStartMarkers is a regression test for a
+// binpkg merge logging both ">>> Emerging (binary)" and ">>> Installing"
+// for the same install at the same timestamp: without coalescing them,
+// the second start line pushes a second inprogress entry that the single
+// "::: completed emerge" line can never retire, leaking it for the life
+// of the process.
+func TestScanLineCoalescesBinpkgStartMarkers(t *testing.T) {
+	p := NewParser()
+	st := newScanState()
+	lines := []string{
+		`1700000000: >>> Emerging (binary) (1 of 1) dev-lang/go-1.21.0 to /`,
+		`1700000000: >>> Installing (1 of 1) dev-lang/go-1.21.0 to /`,
+		`1700000002: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+	}
+	for _, line := range lines {
+		p.scanLine(st, line)
+	}
+	if len(st.compiles) != 1 {
+		t.Fatalf("got %d completed compiles, want 1", len(st.compiles))
+	}
+	if len(st.inprogress) != 0 {
+		t.Fatalf("%d entries left inprogress, want 0 (leaked start marker)", len(st.inprogress))
+	}
+	if len(st.inprogressOrder["dev-lang/go-1.21.0"]) != 0 {
+		t.Fatalf("%d keys left in inprogressOrder, want 0 (leaked start marker)",
+			len(st.inprogressOrder["dev-lang/go-1.21.0"]))
+	}
+}
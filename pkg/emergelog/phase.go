@@ -0,0 +1,160 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// phaseRegEx matches the optional ebuild phase-hook lines some portage
+// configurations write to emerge.log (e.g. via a phase-hooks eclass):
+// ">>> phase compile dev-lang/go-1.21.0 to /". Logs that don't carry this
+// granularity simply never match, and phaseOrder's static fallback
+// fractions are used instead.
+var phaseRegEx = regexp.MustCompile(`>>> phase (?P<phase>[a-z]+) (?P<package>[A-Za-z0-9/_-]+)-(?P<version>\d[^ ]+)`)
+
+// phaseOrder lists the ebuild phases golop knows about, in the order they
+// normally run.
+var phaseOrder = []string{"compile", "install", "postinst", "test"}
+
+// defaultPhaseFractions is the fallback split of total compile duration
+// across phases, used for packages (or logs) that never recorded real
+// phase-hook timestamps. It sums to 1.0.
+var defaultPhaseFractions = map[string]float64{
+	"compile":  0.80,
+	"install":  0.12,
+	"postinst": 0.05,
+	"test":     0.03,
+}
+
+type phaseMark struct {
+	phase string
+	start time.Time
+}
+
+// recordPhase closes out the previous phase seen for pkgver (if any) and
+// opens a new one.
+func (p *Parser) recordPhase(open map[string]phaseMark, pkgver, pkgname, phase string, at time.Time) {
+	if prev, ok := open[pkgver]; ok {
+		p.addPhaseDuration(pkgname, prev.phase, at.Sub(prev.start))
+	}
+	open[pkgver] = phaseMark{phase: phase, start: at}
+}
+
+// closePhase records the duration of the last open phase for pkgver, if
+// any, once the compile it belongs to has completed.
+func (p *Parser) closePhase(open map[string]phaseMark, pkgver, pkgname string, at time.Time) {
+	if prev, ok := open[pkgver]; ok {
+		p.addPhaseDuration(pkgname, prev.phase, at.Sub(prev.start))
+		delete(open, pkgver)
+	}
+}
+
+func (p *Parser) addPhaseDuration(pkgname, phase string, dur time.Duration) {
+	if p.phaseDurations[pkgname] == nil {
+		p.phaseDurations[pkgname] = make(map[string][]time.Duration)
+	}
+	p.phaseDurations[pkgname][phase] = append(p.phaseDurations[pkgname][phase], dur)
+}
+
+// PhaseFractions returns the fraction of pkgname's total compile duration
+// spent in each phase, learned from phase-hook timestamps recorded during
+// a prior FindCompileHist scan. It returns nil if no phase-hook data was
+// seen for pkgname, in which case callers should fall back to
+// defaultPhaseFractions.
+func (p *Parser) PhaseFractions(pkgname string) map[string]float64 {
+	phases, ok := p.phaseDurations[pkgname]
+	if !ok {
+		return nil
+	}
+	var total time.Duration
+	avg := make(map[string]time.Duration, len(phases))
+	for phase, durs := range phases {
+		var sum time.Duration
+		for _, d := range durs {
+			sum += d
+		}
+		a := sum / time.Duration(len(durs))
+		avg[phase] = a
+		total += a
+	}
+	if total == 0 {
+		return nil
+	}
+	fractions := make(map[string]float64, len(avg))
+	for phase, a := range avg {
+		fractions[phase] = float64(a) / float64(total)
+	}
+	return fractions
+}
+
+// remainingFraction returns the fraction of the total estimated duration
+// still ahead once a compile has reached phase, using fractions if given
+// (see PhaseFractions) or defaultPhaseFractions otherwise. Phases golop
+// doesn't recognize leave the whole estimate remaining.
+func remainingFraction(phase string, fractions map[string]float64) float64 {
+	if len(fractions) == 0 {
+		fractions = defaultPhaseFractions
+	}
+	idx := -1
+	for i, ph := range phaseOrder {
+		if ph == phase {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return 1.0
+	}
+	var remaining float64
+	for _, ph := range phaseOrder[idx:] {
+		remaining += fractions[ph]
+	}
+	return remaining
+}
+
+// remainingEstimate returns how much longer a compile is expected to
+// take, given p50 (its historical median total duration), phaseFrac (the
+// fraction of p50 still ahead, from remainingFraction) and elapsed (wall
+// time since the compile started).
+//
+// p50*phaseFrac alone only estimates the time remaining from the start
+// of the current phase onward; elapsed is time since the whole compile
+// started, not since the current phase started. Subtracting elapsed
+// directly double-counts every earlier phase and sends the estimate
+// deeply negative the moment a build leaves its first phase. So elapsed
+// is first reduced by the time earlier phases were expected to take
+// (p50*(1-phaseFrac)) to approximate time spent in the current phase
+// alone.
+func remainingEstimate(p50 time.Duration, phaseFrac float64, elapsed time.Duration) time.Duration {
+	expectedBefore := time.Duration(float64(p50) * (1 - phaseFrac))
+	inPhase := elapsed - expectedBefore
+	if inPhase < 0 {
+		inPhase = 0
+	}
+	return time.Duration(float64(p50)*phaseFrac) - inPhase
+}
+
+// formatETA renders a remaining-time estimate together with its
+// confidence interval and p90, e.g. "12m [±4m, p90 19m]".
+func formatETA(remaining, confidence, p90 time.Duration) string {
+	if remaining <= 0 {
+		return "any time now"
+	}
+	return fmt.Sprintf("%s [±%s, p90 %s]",
+		remaining.Round(time.Second), confidence.Round(time.Second), p90.Round(time.Second))
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemainingFractionOrder(t *testing.T) {
+	fractions := map[string]float64{
+		"compile":  0.80,
+		"install":  0.12,
+		"postinst": 0.05,
+		"test":     0.03,
+	}
+	cases := []struct {
+		phase string
+		want  float64
+	}{
+		{"compile", 1.0},
+		{"install", 0.20},
+		{"postinst", 0.08},
+		{"test", 0.03},
+		{"unknown", 1.0},
+	}
+	for _, tc := range cases {
+		if got := remainingFraction(tc.phase, fractions); !almostEqual(got, tc.want) {
+			t.Errorf("remainingFraction(%q, ...) = %v, want %v", tc.phase, got, tc.want)
+		}
+	}
+}
+
+func TestRemainingFractionFallsBackToDefault(t *testing.T) {
+	got := remainingFraction("install", nil)
+	want := defaultPhaseFractions["install"] + defaultPhaseFractions["postinst"] + defaultPhaseFractions["test"]
+	if !almostEqual(got, want) {
+		t.Errorf("remainingFraction(\"install\", nil) = %v, want %v", got, want)
+	}
+}
+
+// TestRemainingEstimateAccountsForElapsedPhase is a regression test: once
+// a build has moved past its first phase, the ETA must reflect only the
+// time spent in the *current* phase, not the time spent in the whole
+// compile so far, or it goes deeply negative for the entire back half of
+// every build.
+func TestRemainingEstimateAccountsForElapsedPhase(t *testing.T) {
+	fractions := map[string]float64{
+		"compile":  0.80,
+		"install":  0.12,
+		"postinst": 0.05,
+		"test":     0.03,
+	}
+	p50 := 100 * time.Minute
+	phaseFrac := remainingFraction("install", fractions)
+	elapsed := 85 * time.Minute // 80m in compile, 5m into install
+
+	got := remainingEstimate(p50, phaseFrac, elapsed)
+	want := 15 * time.Minute
+	if diff := got - want; diff < -time.Second || diff > time.Second {
+		t.Errorf("remainingEstimate(100m, %v, 85m) = %v, want ~%v", phaseFrac, got, want)
+	}
+}
+
+func TestRemainingEstimateFirstPhase(t *testing.T) {
+	fractions := map[string]float64{
+		"compile":  0.80,
+		"install":  0.12,
+		"postinst": 0.05,
+		"test":     0.03,
+	}
+	p50 := 100 * time.Minute
+	phaseFrac := remainingFraction("compile", fractions)
+	elapsed := 10 * time.Minute
+
+	got := remainingEstimate(p50, phaseFrac, elapsed)
+	want := 90 * time.Minute
+	if diff := got - want; diff < -time.Second || diff > time.Second {
+		t.Errorf("remainingEstimate(100m, %v, 10m) = %v, want ~%v", phaseFrac, got, want)
+	}
+}
+
+func TestRemainingEstimateNeverUsesNegativeInPhaseElapsed(t *testing.T) {
+	// A build reported as still in "compile" but whose total elapsed time
+	// already exceeds p50 shouldn't wrap the in-phase elapsed negative.
+	p50 := 100 * time.Minute
+	phaseFrac := 1.0
+	elapsed := 120 * time.Minute
+	if got := remainingEstimate(p50, phaseFrac, elapsed); got != -20*time.Minute {
+		t.Errorf("remainingEstimate(100m, 1.0, 120m) = %v, want -20m", got)
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	const eps = 1e-9
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+	return d < eps
+}
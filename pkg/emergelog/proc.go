@@ -0,0 +1,123 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type runningCompile struct {
+	pkg   string
+	start time.Time
+	phase string
+}
+
+// RunningCompiles inspects procDir for portage sandbox processes and
+// returns the packages currently being built. It relies on openStarts
+// having been populated by a prior call to FindDurations or
+// FindCompileHist on the same Parser.
+//
+// Sandbox processes are matched to open starts by PID order, oldest PID
+// first, on the assumption that an older PID began its sandbox earlier;
+// each start is handed out at most once, so two concurrent --jobs=N
+// builds of the same package are reported with their own start time and
+// ETA instead of colliding on a single shared one.
+func (p *Parser) RunningCompiles(procDir string) ([]runningCompile, error) {
+	var currpkgs []runningCompile
+	pl, err := processes(procDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pl, func(i, j int) bool { return pl[i].PID < pl[j].PID })
+
+	avail := make(map[string][]int64, len(p.openStarts))
+	for pn, starts := range p.openStarts {
+		cp := make([]int64, len(starts))
+		copy(cp, starts)
+		avail[pn] = cp
+	}
+
+	for _, proc := range pl {
+		if len(proc.Cmdline) > 1 &&
+			strings.HasPrefix(proc.Cmdline[0], "[") &&
+			strings.HasSuffix(proc.Cmdline[0], "sandbox") {
+
+			pkg := strings.Split(proc.Cmdline[0][1:], "]")[0]
+			tok := strings.Split(proc.Cmdline[len(proc.Cmdline)-1], " ")
+			phase := tok[len(tok)-1]
+			pn, _ := splitpkgver(pkg)
+
+			starts, ok := avail[pn]
+			if !ok || len(starts) == 0 {
+				continue
+			}
+			s := time.Unix(starts[0], 0)
+			avail[pn] = starts[1:]
+
+			currpkgs = append(currpkgs, runningCompile{pkg: pkg, start: s, phase: phase})
+		}
+	}
+	return currpkgs, nil
+}
+
+type process struct {
+	PID     uint64
+	Cmdline []string
+}
+
+func processes(dirname string) ([]process, error) {
+	var ps []process
+	entries, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		fp := path.Join(dirname, entry.Name())
+		fi, err := os.Stat(fp)
+		if err != nil {
+			continue
+		}
+		if fi.IsDir() {
+			var proc process
+			proc.PID, err = strconv.ParseUint(entry.Name(), 10, 64)
+			if err == nil {
+				data, err := ioutil.ReadFile(path.Join(fp, "cmdline"))
+				if err != nil {
+					continue
+				}
+				proc.Cmdline = dropEmptyStr(strings.Split(string(data), "\000"))
+				ps = append(ps, proc)
+			}
+		}
+
+	}
+	return ps, nil
+}
+
+func dropEmptyStr(ss []string) []string {
+	var r []string
+	for _, s := range ss {
+		if s != "" {
+			r = append(r, s)
+		}
+	}
+	return r
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeProc writes a fake /proc/<pid>/cmdline entry for a sandbox process
+// building pkgver, currently in phase.
+func fakeProc(t *testing.T, procDir, pid, pkgver, phase string) {
+	t.Helper()
+	dir := filepath.Join(procDir, pid)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	cmdline := "[" + pkgver + "] sandbox\x00" + phase + "\x00"
+	if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// TestRunningCompilesDistinctConcurrentStarts is a regression test for two
+// --jobs=N builds of the same package colliding on a single shared start
+// time/ETA: each /proc sandbox process must be matched to its own open
+// start, oldest PID to oldest start.
+func TestRunningCompilesDistinctConcurrentStarts(t *testing.T) {
+	procDir := t.TempDir()
+	fakeProc(t, procDir, "111", "dev-lang/go-1.21.0", "compile")
+	fakeProc(t, procDir, "222", "dev-lang/go-1.21.0", "compile")
+
+	p := NewParser()
+	p.openStarts = map[string][]int64{
+		"dev-lang/go": {1700000000, 1700000100},
+	}
+
+	curr, err := p.RunningCompiles(procDir)
+	if err != nil {
+		t.Fatalf("RunningCompiles: %v", err)
+	}
+	if len(curr) != 2 {
+		t.Fatalf("RunningCompiles returned %d entries, want 2", len(curr))
+	}
+	if curr[0].start.Unix() == curr[1].start.Unix() {
+		t.Fatalf("both concurrent builds got the same start time %v", curr[0].start)
+	}
+	if curr[0].start.Unix() != 1700000000 || curr[1].start.Unix() != 1700000100 {
+		t.Errorf("starts = %v/%v, want 1700000000/1700000100 (oldest PID first)",
+			curr[0].start.Unix(), curr[1].start.Unix())
+	}
+}
+
+func TestRunningCompilesNoOpenStart(t *testing.T) {
+	procDir := t.TempDir()
+	fakeProc(t, procDir, "111", "dev-lang/go-1.21.0", "compile")
+
+	p := NewParser()
+	curr, err := p.RunningCompiles(procDir)
+	if err != nil {
+		t.Fatalf("RunningCompiles: %v", err)
+	}
+	if len(curr) != 0 {
+		t.Fatalf("RunningCompiles = %+v, want none without a matching open start", curr)
+	}
+}
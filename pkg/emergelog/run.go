@@ -0,0 +1,378 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Version is the golop library/CLI version.
+const Version = "0.2.1"
+
+// ErrNoMatch is returned by Run when ModeEstimate was requested but no
+// compile in the log matched Config.Pattern.
+var ErrNoMatch = errors.New("no compilations matching pattern")
+
+// ErrAggWithStructuredOutput is returned by Run when Config.Aggregate is
+// set together with a non-text Config.Output: aggregates summarize a set
+// of compiles into prose (see aggregateHistory), which has no sensible
+// mapping onto Record, the one-row-per-compile shape JSON/NDJSON/CSV
+// output uses.
+var ErrAggWithStructuredOutput = errors.New("-agg is not supported with -o json/ndjson/csv")
+
+// Mode selects the report Run produces.
+type Mode int
+
+// The modes golop understands, mirroring its command line flags.
+const (
+	ModeHistory Mode = iota
+	ModeCurrent
+	ModeEstimate
+	ModeVersion
+	ModeWatch
+	ModeUnmerge
+)
+
+// Config describes a single golop invocation.
+type Config struct {
+	// LogFile is the path to the emerge.log to parse.
+	LogFile string
+	// ProcDir is the root of the /proc filesystem, used by ModeCurrent.
+	ProcDir string
+	// Mode selects which report to produce.
+	Mode Mode
+	// Pattern is the package name (or substring) ModeEstimate reports on.
+	Pattern string
+	// FilterExpr, if non-empty, is a compound filter expression (see
+	// ParseFilter) applied to the compiles ModeHistory and ModeEstimate
+	// report on.
+	FilterExpr string
+	// Aggregate, if non-empty, names an Aggregation (see
+	// ParseAggregation) that ModeHistory and ModeEstimate report
+	// instead of listing every matching compile.
+	Aggregate string
+	// Listen, if non-empty, is the address ModeWatch serves a Prometheus
+	// /metrics endpoint on, e.g. ":9184".
+	Listen string
+	// PollInterval is how often ModeWatch re-reads the log for new
+	// lines. It defaults to 2 seconds if zero.
+	PollInterval time.Duration
+	// Output names the OutputFormat (see ParseOutputFormat) ModeHistory,
+	// ModeEstimate, ModeCurrent, ModeUnmerge and ModeWatch render their
+	// results in. An empty value means FormatText.
+	Output string
+	// Done, if non-nil, stops ModeWatch's poll loop as soon as it is
+	// closed, so an embedder driving Run directly can get ModeWatch back
+	// under its control instead of only being able to kill the goroutine
+	// it's running on. Ignored by every other mode.
+	Done <-chan struct{}
+}
+
+// Run produces the report selected by cfg.Mode and writes it to out. It
+// touches neither os.Exit nor flag.Parse, so it can be driven directly
+// from tests or from other Go programs embedding golop.
+func Run(cfg Config, out io.Writer) error {
+	switch cfg.Mode {
+	case ModeVersion:
+		fmt.Fprintf(out, "golop version %s\n", Version)
+		return nil
+	case ModeCurrent:
+		return runCurrent(cfg, out)
+	case ModeEstimate:
+		return runEstimate(cfg, out)
+	case ModeHistory:
+		return runHistory(cfg, out)
+	case ModeWatch:
+		return runWatch(cfg, out)
+	case ModeUnmerge:
+		return runUnmerge(cfg, out)
+	default:
+		return fmt.Errorf("unknown mode %d", cfg.Mode)
+	}
+}
+
+func openLog(cfg Config) (*os.File, error) {
+	fd, err := os.Open(cfg.LogFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open log file %q: %w", cfg.LogFile, err)
+	}
+	return fd, nil
+}
+
+func runCurrent(cfg Config, out io.Writer) error {
+	fd, err := openLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	format, err := ParseOutputFormat(cfg.Output)
+	if err != nil {
+		return err
+	}
+
+	p := NewParser()
+	durations := p.FindDurations(fd)
+	curr, err := p.RunningCompiles(cfg.ProcDir)
+	if err != nil {
+		return err
+	}
+	if len(curr) == 0 {
+		fmt.Fprintf(out, "No compilations currently running.\n")
+		return nil
+	}
+
+	var sts []compileStatus
+	longest := 0
+	for _, c := range curr {
+		n, v := splitpkgver(c.pkg)
+		status := compileStatus{pkgname: n, pkgversion: v, phase: c.phase}
+		if len(n) > longest {
+			longest = len(n)
+		}
+		if durs, ok := durations[n]; ok {
+			status.p50 = weightedPercentile(durs, 0.5)
+			status.p90 = weightedPercentile(durs, 0.9)
+			status.confidence = madInterval(durs, status.p50)
+			status.phaseFrac = remainingFraction(c.phase, p.PhaseFractions(n))
+			status.remaining = remainingEstimate(status.p50, status.phaseFrac, time.Since(c.start).Round(time.Second))
+			status.eta = formatETA(status.remaining, status.confidence, status.p90)
+		}
+		status.elapsed = time.Since(c.start).Round(time.Second).String()
+		sts = append(sts, status)
+	}
+	if format != FormatText {
+		return NewEncoder(format).Encode(out, recordsFromStatuses(sts))
+	}
+	fmt.Fprintln(out, tabulate(sts, longest))
+	return nil
+}
+
+func runEstimate(cfg Config, out io.Writer) error {
+	fd, err := openLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	filter, err := ParseFilter(cfg.FilterExpr)
+	if err != nil {
+		return err
+	}
+	agg, err := ParseAggregation(cfg.Aggregate)
+	if err != nil {
+		return err
+	}
+	format, err := ParseOutputFormat(cfg.Output)
+	if err != nil {
+		return err
+	}
+	if agg != AggNone && format != FormatText {
+		return ErrAggWithStructuredOutput
+	}
+
+	p := NewParser()
+	compiles, _, _, _ := p.FindCompileHist(fd, nil)
+	compiles = filterCompiles(compiles, filter)
+	var filtered []compileHist
+	pattern := cfg.Pattern
+
+	// We only want the first match of a possible substring, so we replace
+	// pattern with the full pkgname on first match and then only compare
+	// literally
+	firstmatched := false
+	for _, compile := range compiles {
+		if firstmatched && compile.pkgname == pattern {
+			filtered = append(filtered, compile)
+			continue
+		}
+		// We don't have a match yet, compare more generously
+		if !firstmatched && pkgnameMatch(compile.pkgname, pattern) {
+			filtered = append(filtered, compile)
+			pattern = compile.pkgname
+			firstmatched = true
+		}
+	}
+	if len(filtered) == 0 {
+		return ErrNoMatch
+	}
+
+	if format != FormatText {
+		return NewEncoder(format).Encode(out, recordsFromCompiles(filtered))
+	}
+
+	hists := showHistory(filtered, time.Unix(0, 0), agg)
+	if agg != AggNone {
+		// showHistory already printed the requested aggregate over the
+		// filtered set; a raw, unfiltered median on top would either
+		// contradict it or (for -agg median) just repeat it.
+		fmt.Fprintln(out, hists)
+		return nil
+	}
+
+	durs := make(sortableDurs, 0, len(filtered))
+	for _, c := range filtered {
+		durs = append(durs, c.dur)
+	}
+	meddur := medDuration(durs)
+
+	fmt.Fprintf(out, "%s\nMedian duration: %+v\n", hists, meddur.Round(time.Second))
+	return nil
+}
+
+func runHistory(cfg Config, out io.Writer) error {
+	fd, err := openLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	filter, err := ParseFilter(cfg.FilterExpr)
+	if err != nil {
+		return err
+	}
+	agg, err := ParseAggregation(cfg.Aggregate)
+	if err != nil {
+		return err
+	}
+	format, err := ParseOutputFormat(cfg.Output)
+	if err != nil {
+		return err
+	}
+	if agg != AggNone && format != FormatText {
+		return ErrAggWithStructuredOutput
+	}
+
+	p := NewParser()
+	compiles, _, _, _ := p.FindCompileHist(fd, nil)
+	compiles = filterCompiles(compiles, filter)
+	if format != FormatText {
+		return NewEncoder(format).Encode(out, recordsFromCompiles(compiles))
+	}
+	fmt.Fprintf(out, "%s\n", showHistory(compiles, time.Unix(0, 0), agg))
+	return nil
+}
+
+func runUnmerge(cfg Config, out io.Writer) error {
+	fd, err := openLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	agg, err := ParseAggregation(cfg.Aggregate)
+	if err != nil {
+		return err
+	}
+	format, err := ParseOutputFormat(cfg.Output)
+	if err != nil {
+		return err
+	}
+	if agg != AggNone && format != FormatText {
+		return ErrAggWithStructuredOutput
+	}
+
+	p := NewParser()
+	_, _, _, unmerges := p.FindCompileHist(fd, nil)
+	if format != FormatText {
+		return NewEncoder(format).Encode(out, recordsFromUnmerges(unmerges))
+	}
+	fmt.Fprintf(out, "%s\n", showUnmergeHistory(unmerges, agg))
+	return nil
+}
+
+func runWatch(cfg Config, out io.Writer) error {
+	format, err := ParseOutputFormat(cfg.Output)
+	if err != nil {
+		return err
+	}
+
+	w, err := NewWatcher(cfg.LogFile)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", NewExporter(w))
+		go func() {
+			if err := http.ListenAndServe(cfg.Listen, mux); err != nil {
+				fmt.Fprintf(os.Stderr, "metrics server on %s stopped: %v\n", cfg.Listen, err)
+			}
+		}()
+	}
+
+	interval := cfg.PollInterval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cfg.Done:
+			return nil
+		case <-ticker.C:
+			if err := w.Poll(); err != nil {
+				fmt.Fprintf(out, "tail error: %v\n", err)
+				continue
+			}
+			printWatchStatus(w, out, format)
+		}
+	}
+}
+
+func printWatchStatus(w *Watcher, out io.Writer, format OutputFormat) {
+	inprog := w.InProgress()
+	if len(inprog) == 0 {
+		if format == FormatText {
+			fmt.Fprintln(out, "No compilations currently running.")
+		}
+		return
+	}
+
+	var sts []compileStatus
+	longest := 0
+	durations := w.Durations()
+	for key, c := range inprog {
+		if len(c.pkgname) > longest {
+			longest = len(c.pkgname)
+		}
+		phase, _ := w.CurrentPhase(basePkgver(key))
+		status := compileStatus{pkgname: c.pkgname, pkgversion: c.pkgversion, phase: phase}
+		if durs, ok := durations[c.pkgname]; ok {
+			status.p50 = weightedPercentile(durs, 0.5)
+			status.p90 = weightedPercentile(durs, 0.9)
+			status.confidence = madInterval(durs, status.p50)
+			status.phaseFrac = remainingFraction(phase, w.PhaseFractions(c.pkgname))
+			status.remaining = remainingEstimate(status.p50, status.phaseFrac, time.Since(c.start).Round(time.Second))
+			status.eta = formatETA(status.remaining, status.confidence, status.p90)
+		}
+		status.elapsed = time.Since(c.start).Round(time.Second).String()
+		sts = append(sts, status)
+	}
+	if format != FormatText {
+		if err := NewEncoder(format).Encode(out, recordsFromStatuses(sts)); err != nil {
+			fmt.Fprintf(out, "encode error: %v\n", err)
+		}
+		return
+	}
+	fmt.Fprintln(out, tabulate(sts, longest))
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunModeVersion(t *testing.T) {
+	var out bytes.Buffer
+	if err := Run(Config{Mode: ModeVersion}, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), Version) {
+		t.Errorf("Run(ModeVersion) = %q, want it to contain %q", out.String(), Version)
+	}
+}
+
+func TestRunModeHistory(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+		`1700000600: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+	)
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeHistory}
+	if err := Run(cfg, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), "dev-lang/go-1.21.0") {
+		t.Errorf("Run(ModeHistory) = %q, want it to mention dev-lang/go-1.21.0", out.String())
+	}
+}
+
+func TestRunModeHistoryJSONIgnoresAggregate(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+		`1700000600: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+	)
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeHistory, Aggregate: "sum", Output: "json"}
+	err := Run(cfg, &out)
+	if !errors.Is(err, ErrAggWithStructuredOutput) {
+		t.Fatalf("Run(-agg with -o json) error = %v, want ErrAggWithStructuredOutput", err)
+	}
+}
+
+func TestRunModeEstimate(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+		`1700000600: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+	)
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeEstimate, Pattern: "dev-lang/go"}
+	if err := Run(cfg, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), "Median duration") {
+		t.Errorf("Run(ModeEstimate) = %q, want it to report a median duration", out.String())
+	}
+}
+
+func TestRunModeEstimateNoMatch(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+		`1700000600: ::: completed emerge (1 of 1) dev-lang/go-1.21.0 to /`,
+	)
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeEstimate, Pattern: "dev-lang/rust"}
+	err := Run(cfg, &out)
+	if !errors.Is(err, ErrNoMatch) {
+		t.Fatalf("Run error = %v, want ErrNoMatch", err)
+	}
+}
+
+func TestRunModeUnmerge(t *testing.T) {
+	f := writeLog(t,
+		`1700000000: === Unmerging... (dev-lang/go-1.20.0)`,
+		`1700000010: >>> unmerge success: dev-lang/go-1.20.0`,
+	)
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeUnmerge}
+	if err := Run(cfg, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), "dev-lang/go-1.20.0") {
+		t.Errorf("Run(ModeUnmerge) = %q, want it to mention dev-lang/go-1.20.0", out.String())
+	}
+}
+
+func TestRunModeCurrent(t *testing.T) {
+	f := writeLog(t, `1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`)
+	procDir := t.TempDir()
+	fakeProc(t, procDir, "111", "dev-lang/go-1.21.0", "compile")
+
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeCurrent, ProcDir: procDir}
+	if err := Run(cfg, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), "dev-lang/go") {
+		t.Errorf("Run(ModeCurrent) = %q, want it to mention dev-lang/go", out.String())
+	}
+}
+
+func TestRunModeCurrentJSONSplitsVersionFromPackage(t *testing.T) {
+	f := writeLog(t, `1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`)
+	procDir := t.TempDir()
+	fakeProc(t, procDir, "111", "dev-lang/go-1.21.0", "compile")
+
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeCurrent, ProcDir: procDir, Output: "json"}
+	if err := Run(cfg, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var records []Record
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+		t.Fatalf("json.Unmarshal: %v\n%s", err, out.String())
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r.Category != "dev-lang" || r.Package != "go" || r.Version != "1.21.0" {
+		t.Errorf("record = %+v, want category=dev-lang package=go version=1.21.0", r)
+	}
+}
+
+func TestRunModeCurrentNoneRunning(t *testing.T) {
+	f := writeLog(t, `1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`)
+	var out bytes.Buffer
+	cfg := Config{LogFile: f.Name(), Mode: ModeCurrent, ProcDir: t.TempDir()}
+	if err := Run(cfg, &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), "No compilations currently running") {
+		t.Errorf("Run(ModeCurrent) = %q, want the no-compiles message", out.String())
+	}
+}
+
+// TestRunModeWatchStopsOnDone drives ModeWatch through at least one poll
+// tick and then closes cfg.Done, checking that Run returns promptly
+// instead of blocking forever in its ticker loop — the one thing an
+// embedder needs to get ModeWatch back under its control.
+func TestRunModeWatchStopsOnDone(t *testing.T) {
+	f := writeLog(t, `1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`)
+	done := make(chan struct{})
+	var out bytes.Buffer
+	cfg := Config{
+		LogFile:      f.Name(),
+		Mode:         ModeWatch,
+		PollInterval: time.Millisecond,
+		Output:       "ndjson",
+		Done:         done,
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- Run(cfg, &out) }()
+
+	// Give the ticker a chance to fire at least once before stopping it.
+	time.Sleep(20 * time.Millisecond)
+	close(done)
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Run(ModeWatch): %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run(ModeWatch) did not return after cfg.Done was closed")
+	}
+	if !strings.Contains(out.String(), `"category":"dev-lang"`) {
+		t.Errorf("Run(ModeWatch) output = %q, want it to mention dev-lang/go from at least one tick", out.String())
+	}
+}
+
+func TestPrintWatchStatus(t *testing.T) {
+	f := writeLog(t, `1700000000: >>> emerge (1 of 1) dev-lang/go-1.21.0 to /`)
+	w, err := NewWatcher(f.Name())
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+
+	var out bytes.Buffer
+	printWatchStatus(w, &out, FormatText)
+	if !strings.Contains(out.String(), "dev-lang/go") {
+		t.Errorf("printWatchStatus output = %q, want it to mention dev-lang/go", out.String())
+	}
+}
+
+func TestPrintWatchStatusNoneRunning(t *testing.T) {
+	f := writeLog(t, `1700000000: === Unmerging... (dev-lang/go-1.20.0)`)
+	w, err := NewWatcher(f.Name())
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+
+	var out bytes.Buffer
+	printWatchStatus(w, &out, FormatText)
+	if !strings.Contains(out.String(), "No compilations currently running") {
+		t.Errorf("printWatchStatus output = %q, want the no-compiles message", out.String())
+	}
+}
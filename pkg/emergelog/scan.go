@@ -0,0 +1,190 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scanState accumulates the per-line state FindCompileHist builds up over
+// a scan. It is also what lets a Watcher drive the same state machine
+// incrementally, one newly-tailed line at a time, instead of re-scanning
+// the whole log on every tick.
+type scanState struct {
+	compiles         []compileHist
+	durations        map[string][]time.Duration
+	inprogress       map[string]compileHist // keyed by instanceKey(pkgver, starttimestamp)
+	inprogressOrder  map[string][]string    // pkgver -> open instance keys, oldest first
+	unmergeStarts    map[string]unmergeHist // keyed by pkgver
+	unmergeCompleted []unmergeHist
+	phasestart       map[string]phaseMark
+	lineno           int
+}
+
+func newScanState() *scanState {
+	return &scanState{
+		durations:       make(map[string][]time.Duration),
+		inprogress:      make(map[string]compileHist),
+		inprogressOrder: make(map[string][]string),
+		unmergeStarts:   make(map[string]unmergeHist),
+		phasestart:      make(map[string]phaseMark),
+	}
+}
+
+// instanceKey identifies a single compile instance by its package-version
+// and start timestamp, so two concurrent emerges of the same
+// package-version (possible under --jobs=N) don't collide.
+func instanceKey(pkgver string, ts int64) string {
+	return fmt.Sprintf("%s@%d", pkgver, ts)
+}
+
+// basePkgver strips the "@starttimestamp" suffix instanceKey adds, e.g.
+// to recover "cat/pkg-1.0" from "cat/pkg-1.0@1700000000".
+func basePkgver(key string) string {
+	if i := strings.LastIndex(key, "@"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// scanLine feeds a single emerge.log line into st, updating it in place.
+// It is the state machine shared by FindCompileHist's one-shot scan and
+// Watcher's incremental tail.
+func (p *Parser) scanLine(st *scanState, line string) {
+	st.lineno++
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		// A line we can't parse: we'll have to just ignore it
+		return
+	}
+	message := strings.Join(fields[1:], " ")
+	ts, err := strconv.ParseInt(fields[0][:len(fields[0])-1], 10, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not parse timestamp on line %d: %+v\n", st.lineno, err)
+		return
+	}
+	dt := time.Unix(ts, 0)
+
+	switch {
+	case compileStartRegEx.MatchString(message):
+		p.startCompile(st, compileStartRegEx, message, dt, ts, false)
+		return
+	case binaryStartRegEx.MatchString(message):
+		p.startCompile(st, binaryStartRegEx, message, dt, ts, true)
+		return
+	case installStartRegEx.MatchString(message):
+		p.startCompile(st, installStartRegEx, message, dt, ts, true)
+		return
+	case phaseRegEx.MatchString(message):
+		values := getReMatches(phaseRegEx, message)
+		pkgver := fmt.Sprintf("%v-%v", values["package"], values["version"])
+		p.recordPhase(st.phasestart, pkgver, values["package"], values["phase"], dt)
+		return
+	case unmergeStartRegEx.MatchString(message):
+		values := getReMatches(unmergeStartRegEx, message)
+		pkgver := fmt.Sprintf("%v-%v", values["package"], values["version"])
+		st.unmergeStarts[pkgver] = unmergeHist{
+			start:      dt,
+			pkgname:    values["package"],
+			pkgversion: values["version"],
+		}
+		return
+	case unmergeCompleteRegEx.MatchString(message):
+		values := getReMatches(unmergeCompleteRegEx, message)
+		pkgver := fmt.Sprintf("%v-%v", values["package"], values["version"])
+		u, ok := st.unmergeStarts[pkgver]
+		if !ok {
+			return
+		}
+		u.end = dt
+		u.dur = u.end.Sub(u.start)
+		st.unmergeCompleted = append(st.unmergeCompleted, u)
+		delete(st.unmergeStarts, pkgver)
+		return
+	case compileCompleteRegEx.MatchString(message):
+		values := getReMatches(compileCompleteRegEx, message)
+		pkgver := fmt.Sprintf("%v-%v", values["package"], values["version"])
+		order := st.inprogressOrder[pkgver]
+		if len(order) == 0 {
+			return
+		}
+		key := order[0]
+		st.inprogressOrder[pkgver] = order[1:]
+		c := st.inprogress[key]
+		delete(st.inprogress, key)
+
+		c.end = dt
+		c.dur = c.end.Sub(c.start)
+		st.compiles = append(st.compiles, c)
+		if !c.binary {
+			st.durations[c.pkgname] = append(st.durations[c.pkgname], c.dur)
+		}
+		p.closePhase(st.phasestart, pkgver, c.pkgname, dt)
+		return
+	}
+}
+
+func (p *Parser) startCompile(st *scanState, re *regexp.Regexp, message string, dt time.Time, ts int64, binary bool) {
+	values := getReMatches(re, message)
+	pkgver := fmt.Sprintf("%v-%v", values["package"], values["version"])
+
+	if binary {
+		// A binpkg install can log both ">>> Emerging (binary)" and
+		// ">>> Installing" for the same merge, back to back at the same
+		// timestamp. Only one "::: completed emerge" line ever follows,
+		// so treating the second start line as a new instance would
+		// leak an entry in st.inprogress/inprogressOrder for the
+		// lifetime of the process (fatal for Watcher, which runs
+		// indefinitely). Recognize the repeat and skip it.
+		if order := st.inprogressOrder[pkgver]; len(order) > 0 {
+			if last := st.inprogress[order[len(order)-1]]; last.binary && last.start.Equal(dt) {
+				return
+			}
+		}
+	}
+
+	c := compileHist{
+		start:      dt,
+		pkgname:    values["package"],
+		pkgversion: values["version"],
+		binary:     binary,
+	}
+	key := instanceKey(pkgver, ts)
+	st.inprogress[key] = c
+	st.inprogressOrder[pkgver] = append(st.inprogressOrder[pkgver], key)
+}
+
+// recordOpenStarts replaces p.openStarts with the start timestamps of
+// whatever compiles are still open in st, i.e. those that never saw a
+// matching "::: completed emerge" line before the scan ended. Results
+// are sorted oldest first per package so RunningCompiles can hand out
+// distinct starts to concurrent --jobs=N builds of the same package in
+// the order they began.
+func (p *Parser) recordOpenStarts(st *scanState) {
+	open := make(map[string][]int64)
+	for _, c := range st.inprogress {
+		open[c.pkgname] = append(open[c.pkgname], c.start.Unix())
+	}
+	for _, starts := range open {
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	}
+	p.openStarts = open
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// decayRate controls how much more heavily the most recent compiles are
+// weighted over older ones when computing percentiles: a weight of
+// exp(-decayRate*age), age being the number of more-recent samples.
+const decayRate = 0.15
+
+// weightedPercentile returns the pct-th (0..1) weighted percentile of
+// durs, weighting samples by recency so a machine that recently got
+// faster or slower is reflected quickly. durs is expected in
+// chronological order, oldest first, as returned by FindDurations.
+func weightedPercentile(durs []time.Duration, pct float64) time.Duration {
+	n := len(durs)
+	if n == 0 {
+		return 0
+	}
+	type weighted struct {
+		d time.Duration
+		w float64
+	}
+	ws := make([]weighted, n)
+	for i, d := range durs {
+		age := float64(n - 1 - i)
+		ws[i] = weighted{d: d, w: math.Exp(-decayRate * age)}
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].d < ws[j].d })
+
+	var total float64
+	for _, w := range ws {
+		total += w.w
+	}
+	target := total * pct
+	var cum float64
+	for _, w := range ws {
+		cum += w.w
+		if cum >= target {
+			return w.d
+		}
+	}
+	return ws[n-1].d
+}
+
+// madInterval returns a MAD-based confidence interval (the ± in "ETA: 12m
+// [±4m, p90 19m]") around median, scaled by the usual 1.4826
+// constant so it approximates a standard deviation under normally
+// distributed durations.
+func madInterval(durs []time.Duration, median time.Duration) time.Duration {
+	if len(durs) == 0 {
+		return 0
+	}
+	diffs := make(sortableDurs, len(durs))
+	for i, d := range durs {
+		diff := d - median
+		if diff < 0 {
+			diff = -diff
+		}
+		diffs[i] = diff
+	}
+	mad := medDuration(diffs)
+	return time.Duration(1.4826 * float64(mad))
+}
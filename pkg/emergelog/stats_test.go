@@ -0,0 +1,72 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeightedPercentileEmpty(t *testing.T) {
+	if got := weightedPercentile(nil, 0.5); got != 0 {
+		t.Errorf("weightedPercentile(nil, 0.5) = %v, want 0", got)
+	}
+}
+
+func TestWeightedPercentileUniform(t *testing.T) {
+	durs := []time.Duration{
+		10 * time.Minute, 10 * time.Minute, 10 * time.Minute, 10 * time.Minute,
+	}
+	if got := weightedPercentile(durs, 0.5); got != 10*time.Minute {
+		t.Errorf("weightedPercentile(uniform, 0.5) = %v, want 10m", got)
+	}
+	if got := weightedPercentile(durs, 0.9); got != 10*time.Minute {
+		t.Errorf("weightedPercentile(uniform, 0.9) = %v, want 10m", got)
+	}
+}
+
+func TestWeightedPercentileP90GreaterEqualMedian(t *testing.T) {
+	durs := []time.Duration{
+		5 * time.Minute, 8 * time.Minute, 9 * time.Minute, 30 * time.Minute, 31 * time.Minute,
+	}
+	p50 := weightedPercentile(durs, 0.5)
+	p90 := weightedPercentile(durs, 0.9)
+	if p90 < p50 {
+		t.Errorf("p90 (%v) < p50 (%v)", p90, p50)
+	}
+}
+
+func TestMadIntervalZeroForIdenticalDurations(t *testing.T) {
+	durs := []time.Duration{10 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	if got := madInterval(durs, 10*time.Minute); got != 0 {
+		t.Errorf("madInterval(identical durations) = %v, want 0", got)
+	}
+}
+
+func TestMadIntervalEmpty(t *testing.T) {
+	if got := madInterval(nil, 10*time.Minute); got != 0 {
+		t.Errorf("madInterval(nil, ...) = %v, want 0", got)
+	}
+}
+
+func TestMadIntervalScalesWithSpread(t *testing.T) {
+	tight := []time.Duration{9 * time.Minute, 10 * time.Minute, 11 * time.Minute}
+	wide := []time.Duration{1 * time.Minute, 10 * time.Minute, 19 * time.Minute}
+	tightMAD := madInterval(tight, 10*time.Minute)
+	wideMAD := madInterval(wide, 10*time.Minute)
+	if wideMAD <= tightMAD {
+		t.Errorf("madInterval(wide) = %v, want it greater than madInterval(tight) = %v", wideMAD, tightMAD)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Tobias Klausmann
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package emergelog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher tails an emerge.log incrementally, feeding newly appended lines
+// through Parser.scanLine so it never has to re-read the whole file. It
+// reopens the log if its inode changes underneath it, which is how
+// logrotate replaces /var/log/emerge.log.
+//
+// Poll is expected to run from one goroutine (the poll ticker), while
+// the accessor methods below may be called concurrently from another
+// (the Prometheus Exporter's ServeHTTP). mu guards every field Poll
+// mutates, and accessors return copies taken under mu rather than
+// references into live state, so a concurrent Poll can't be observed
+// mid-update or race with a map/slice read.
+type Watcher struct {
+	mu     sync.RWMutex
+	path   string
+	fd     *os.File
+	offset int64
+	inode  uint64
+	parser *Parser
+	st     *scanState
+}
+
+// NewWatcher opens path and does an initial full read to seed the
+// in-memory model, then returns ready for incremental Poll calls.
+func NewWatcher(path string) (*Watcher, error) {
+	w := &Watcher{
+		path:   path,
+		parser: NewParser(),
+		st:     newScanState(),
+	}
+	if err := w.reopen(); err != nil {
+		return nil, err
+	}
+	if err := w.Poll(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Watcher) reopen() error {
+	if w.fd != nil {
+		w.fd.Close()
+	}
+	fd, err := os.Open(w.path)
+	if err != nil {
+		return fmt.Errorf("could not open log file %q: %w", w.path, err)
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	w.fd = fd
+	w.offset = 0
+	w.inode = inodeOf(fi)
+	return nil
+}
+
+// Poll reads whatever has been appended to the log since the last call
+// (or since NewWatcher, on the first call) and folds it into the
+// in-memory model. It reopens the log if logrotate has replaced it.
+func (w *Watcher) Poll() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	if inodeOf(fi) != w.inode {
+		if err := w.reopen(); err != nil {
+			return err
+		}
+	} else if fi.Size() < w.offset {
+		// Truncated in place (e.g. "copytruncate" log rotation).
+		w.offset = 0
+	}
+	if _, err := w.fd.Seek(w.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(w.fd)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Incomplete trailing line (or EOF): leave it for the next
+			// Poll instead of consuming a partial line from offset.
+			break
+		}
+		w.offset += int64(len(line))
+		w.parser.scanLine(w.st, line[:len(line)-1])
+	}
+	return nil
+}
+
+func inodeOf(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// Completed returns the compiles seen so far, in log order. The result
+// is a copy, safe to use after Poll has run again concurrently.
+func (w *Watcher) Completed() []compileHist {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	out := make([]compileHist, len(w.st.compiles))
+	copy(out, w.st.compiles)
+	return out
+}
+
+// InProgress returns the compiles that have started but not yet
+// completed, keyed by "pkgname-pkgversion@starttimestamp" (see
+// instanceKey) so concurrent emerges of the same package-version don't
+// collide. Use basePkgver to recover the plain "pkgname-pkgversion" from
+// a key. The result is a copy, safe to use after Poll has run again
+// concurrently.
+func (w *Watcher) InProgress() map[string]compileHist {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	out := make(map[string]compileHist, len(w.st.inprogress))
+	for k, v := range w.st.inprogress {
+		out[k] = v
+	}
+	return out
+}
+
+// Durations returns every duration seen so far per package. The result is
+// a copy, safe to use after Poll has run again concurrently.
+func (w *Watcher) Durations() map[string][]time.Duration {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	out := make(map[string][]time.Duration, len(w.st.durations))
+	for k, v := range w.st.durations {
+		cp := make([]time.Duration, len(v))
+		copy(cp, v)
+		out[k] = cp
+	}
+	return out
+}
+
+// UnmergeTotal returns the number of completed unmerges seen so far.
+func (w *Watcher) UnmergeTotal() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.st.unmergeCompleted)
+}
+
+// CurrentPhase returns the most recently seen phase for pkgver, if any
+// phase-hook line has been seen for it. pkgver must be a plain
+// "pkgname-pkgversion", not an InProgress key (see basePkgver).
+func (w *Watcher) CurrentPhase(pkgver string) (string, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	m, ok := w.st.phasestart[pkgver]
+	if !ok {
+		return "", false
+	}
+	return m.phase, true
+}
+
+// PhaseFractions returns the fraction of pkgname's total compile duration
+// spent in each phase, as learned by the underlying Parser (see
+// Parser.PhaseFractions). Unlike the removed Parser accessor, this takes
+// the same lock Poll does, so it can't race with phase durations being
+// recorded mid-scan.
+func (w *Watcher) PhaseFractions(pkgname string) map[string]float64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.parser.PhaseFractions(pkgname)
+}